@@ -0,0 +1,156 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// EventType describes what happened to a pod's or container's resources.
+type EventType string
+
+const (
+	// EventAdded is emitted the first time resources are recorded for a pod
+	// or container, and synthetically by Replay for late subscribers.
+	EventAdded EventType = "Added"
+	// EventUpdated is emitted when previously recorded resources change.
+	EventUpdated EventType = "Updated"
+	// EventDeleted is emitted when a pod's or container's resources are removed.
+	EventDeleted EventType = "Deleted"
+)
+
+// ResourceEvent describes a single change to the allocation state. ContainerName
+// is empty for pod-scoped changes (pod-level resources, the whole
+// PodResourceInfo, or a pod deletion) and set for a single container's change.
+type ResourceEvent struct {
+	PodUID        types.UID
+	ContainerName string
+	OldResources  PodResourceInfo
+	NewResources  PodResourceInfo
+	EventType     EventType
+}
+
+// subscriberChannelCapacity bounds how many undelivered events a slow
+// subscriber can accumulate before new events start displacing old ones.
+const subscriberChannelCapacity = 64
+
+// subscriber is one named consumer of resource change events.
+type subscriber struct {
+	ch     chan ResourceEvent
+	missed uint64
+}
+
+// send delivers event without ever blocking the caller: if the subscriber's
+// channel is full, the oldest pending event is dropped to make room and the
+// subscriber's missed counter is incremented.
+func (s *subscriber) send(event ResourceEvent) {
+	select {
+	case s.ch <- event:
+		return
+	default:
+	}
+
+	select {
+	case <-s.ch:
+		atomic.AddUint64(&s.missed, 1)
+	default:
+	}
+
+	select {
+	case s.ch <- event:
+	default:
+		atomic.AddUint64(&s.missed, 1)
+	}
+}
+
+// eventBroadcaster fans out ResourceEvents to named subscribers. It is safe
+// for concurrent use and never blocks a publisher on a slow subscriber.
+type eventBroadcaster struct {
+	mu   sync.Mutex
+	subs map[string]*subscriber
+}
+
+func newEventBroadcaster() *eventBroadcaster {
+	return &eventBroadcaster{subs: make(map[string]*subscriber)}
+}
+
+// subscribe registers name, replacing any existing subscriber of the same
+// name, and returns its event channel plus an unsubscribe function. The
+// previous subscriber's channel, if any, is closed so anything still
+// ranging over it unblocks instead of hanging forever.
+func (b *eventBroadcaster) subscribe(name string) (<-chan ResourceEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if old, ok := b.subs[name]; ok {
+		close(old.ch)
+	}
+
+	sub := &subscriber{ch: make(chan ResourceEvent, subscriberChannelCapacity)}
+	b.subs[name] = sub
+
+	return sub.ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if existing, ok := b.subs[name]; ok && existing == sub {
+			delete(b.subs, name)
+			close(sub.ch)
+		}
+	}
+}
+
+// publish fans event out to every current subscriber without blocking.
+func (b *eventBroadcaster) publish(event ResourceEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, sub := range b.subs {
+		sub.send(event)
+	}
+}
+
+// replay sends a synthetic EventAdded for every entry in snapshot to the
+// named subscriber only, so it can build a consistent starting view.
+func (b *eventBroadcaster) replay(name string, snapshot PodResourceInfoMap) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub, ok := b.subs[name]
+	if !ok {
+		return
+	}
+
+	for podUID, info := range snapshot {
+		sub.send(ResourceEvent{
+			PodUID:       podUID,
+			NewResources: info,
+			EventType:    EventAdded,
+		})
+	}
+}
+
+// missed returns how many events have been dropped for the named subscriber.
+func (b *eventBroadcaster) missed(name string) uint64 {
+	b.mu.Lock()
+	sub, ok := b.subs[name]
+	b.mu.Unlock()
+	if !ok {
+		return 0
+	}
+	return atomic.LoadUint64(&sub.missed)
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestEventBroadcasterPublishDeliversToSubscriber(t *testing.T) {
+	b := newEventBroadcaster()
+	ch, unsubscribe := b.subscribe("sub")
+	defer unsubscribe()
+
+	b.publish(ResourceEvent{PodUID: types.UID("pod-a"), EventType: EventAdded})
+
+	select {
+	case event := <-ch:
+		if event.PodUID != "pod-a" {
+			t.Errorf("PodUID = %v, want pod-a", event.PodUID)
+		}
+	default:
+		t.Fatal("expected an event to be delivered, got none")
+	}
+}
+
+// TestEventBroadcasterDropsOldestWhenFull verifies the documented
+// never-block-the-publisher policy: once a subscriber's channel is full,
+// the oldest pending event is dropped and missed is incremented.
+func TestEventBroadcasterDropsOldestWhenFull(t *testing.T) {
+	b := newEventBroadcaster()
+	_, unsubscribe := b.subscribe("sub")
+	defer unsubscribe()
+
+	for i := 0; i < subscriberChannelCapacity+1; i++ {
+		b.publish(ResourceEvent{PodUID: types.UID("pod-a"), EventType: EventAdded})
+	}
+
+	if got := b.missed("sub"); got != 1 {
+		t.Errorf("missed(\"sub\") = %d, want 1", got)
+	}
+}
+
+func TestEventBroadcasterReplaySendsSnapshot(t *testing.T) {
+	b := newEventBroadcaster()
+	ch, unsubscribe := b.subscribe("sub")
+	defer unsubscribe()
+
+	b.replay("sub", PodResourceInfoMap{"pod-a": {}})
+
+	select {
+	case event := <-ch:
+		if event.EventType != EventAdded || event.PodUID != "pod-a" {
+			t.Errorf("replayed event = %+v, want a synthetic EventAdded for pod-a", event)
+		}
+	default:
+		t.Fatal("expected a replayed event, got none")
+	}
+}
+
+func TestEventBroadcasterUnsubscribeClosesChannel(t *testing.T) {
+	b := newEventBroadcaster()
+	ch, unsubscribe := b.subscribe("sub")
+	unsubscribe()
+
+	if _, ok := <-ch; ok {
+		t.Error("channel received a value after unsubscribe, want it closed")
+	}
+}
+
+// TestEventBroadcasterResubscribeClosesPreviousChannel guards against a
+// goroutine leak: subscribing again under a name that is already
+// registered must close the superseded subscriber's channel so anything
+// still ranging over it unblocks, and the old subscription's unsubscribe
+// function must leave the new subscription in place.
+func TestEventBroadcasterResubscribeClosesPreviousChannel(t *testing.T) {
+	b := newEventBroadcaster()
+	oldCh, oldUnsubscribe := b.subscribe("sub")
+	newCh, newUnsubscribe := b.subscribe("sub")
+	defer newUnsubscribe()
+
+	if _, ok := <-oldCh; ok {
+		t.Error("previous subscriber's channel received a value, want it closed by the re-subscribe")
+	}
+
+	// The superseded unsubscribe function must not affect the new
+	// subscription.
+	oldUnsubscribe()
+	b.publish(ResourceEvent{PodUID: types.UID("pod-a"), EventType: EventAdded})
+	select {
+	case <-newCh:
+	default:
+		t.Error("new subscriber stopped receiving events after the old unsubscribe function ran")
+	}
+}
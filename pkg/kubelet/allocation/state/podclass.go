@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// PodClass categorizes a pod for the purpose of resource reservation
+// accounting, letting callers ask "how much is allocated to platform pods"
+// without re-deriving the answer from labels on every query.
+type PodClass string
+
+const (
+	// PodClassUser is the default class for ordinary workload pods.
+	PodClassUser PodClass = "User"
+	// PodClassPlatform is for pods that make up the platform itself (e.g.
+	// identified by a designated label on the pod or its namespace).
+	PodClassPlatform PodClass = "Platform"
+	// PodClassSystem is for node-level system pods (e.g. static pods run by
+	// the kubelet itself).
+	PodClassSystem PodClass = "System"
+)
+
+// ClassifierFunc maps a pod to its PodClass. One is supplied at State
+// construction so the mapping from labels/namespaces to classes lives in one
+// configurable place instead of being hardcoded into the state package; it
+// is invoked through State.ClassifyPod.
+type ClassifierFunc func(pod *v1.Pod) PodClass
+
+// DefaultClassifier classifies every pod as PodClassUser. It is used when no
+// ClassifierFunc is supplied at construction.
+func DefaultClassifier(_ *v1.Pod) PodClass {
+	return PodClassUser
+}
+
+// resourceTotals tracks the aggregated requests and limits for a PodClass.
+type resourceTotals struct {
+	requests v1.ResourceList
+	limits   v1.ResourceList
+}
+
+func newResourceTotals() resourceTotals {
+	return resourceTotals{requests: v1.ResourceList{}, limits: v1.ResourceList{}}
+}
+
+// podContribution is the last totals a pod added to its class, kept so it
+// can be subtracted precisely the next time that pod's resources or class
+// change, without rescanning every pod.
+type podContribution struct {
+	class    PodClass
+	requests v1.ResourceList
+	limits   v1.ResourceList
+}
+
+// addResourceListInto adds src into dst in place.
+func addResourceListInto(dst v1.ResourceList, src v1.ResourceList) {
+	for name, quantity := range src {
+		if existing, ok := dst[name]; ok {
+			quantity.Add(existing)
+		}
+		dst[name] = quantity
+	}
+}
+
+// subtractResourceListFrom subtracts src from dst in place, dropping entries
+// that fall to zero so empty classes report an empty ResourceList.
+func subtractResourceListFrom(dst v1.ResourceList, src v1.ResourceList) {
+	for name, quantity := range src {
+		existing, ok := dst[name]
+		if !ok {
+			continue
+		}
+		existing.Sub(quantity)
+		if existing.IsZero() {
+			delete(dst, name)
+			continue
+		}
+		dst[name] = existing
+	}
+}
+
+// aggregateResources returns the requests and limits implied by info,
+// preferring PodLevelResources when set and otherwise summing
+// ContainerResources, mirroring the precedence used by ComputeQoS.
+func aggregateResources(info PodResourceInfo) (requests, limits v1.ResourceList) {
+	requests, limits = v1.ResourceList{}, v1.ResourceList{}
+
+	if len(info.PodLevelResources.Requests) > 0 || len(info.PodLevelResources.Limits) > 0 {
+		addResourceListInto(requests, info.PodLevelResources.Requests)
+		addResourceListInto(limits, info.PodLevelResources.Limits)
+		return requests, limits
+	}
+
+	for _, containerResources := range info.ContainerResources {
+		addResourceListInto(requests, containerResources.Requests)
+		addResourceListInto(limits, containerResources.Limits)
+	}
+	return requests, limits
+}
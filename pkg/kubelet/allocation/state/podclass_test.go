@@ -0,0 +1,195 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func cpuQuantity(v string) resource.Quantity {
+	return resource.MustParse(v)
+}
+
+func TestAggregateResourcesPrefersPodLevel(t *testing.T) {
+	info := PodResourceInfo{
+		PodLevelResources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceCPU: cpuQuantity("1")},
+		},
+		ContainerResources: map[string]v1.ResourceRequirements{
+			"c1": {Requests: v1.ResourceList{v1.ResourceCPU: cpuQuantity("5")}},
+		},
+	}
+	requests, _ := aggregateResources(info)
+	if got := requests.Cpu().String(); got != "1" {
+		t.Errorf("requests cpu = %s, want 1 (pod-level should win over container sum)", got)
+	}
+}
+
+func TestAggregateResourcesSumsContainers(t *testing.T) {
+	info := PodResourceInfo{
+		ContainerResources: map[string]v1.ResourceRequirements{
+			"c1": {Requests: v1.ResourceList{v1.ResourceCPU: cpuQuantity("1")}},
+			"c2": {Requests: v1.ResourceList{v1.ResourceCPU: cpuQuantity("2")}},
+		},
+	}
+	requests, _ := aggregateResources(info)
+	if got := requests.Cpu().String(); got != "3" {
+		t.Errorf("requests cpu = %s, want 3", got)
+	}
+}
+
+// TestStateMemoryUnclassifiedPodDefaultsToUser ensures a pod with no
+// explicit SetPodClass call is aggregated as PodClassUser, without the
+// injected classifier ever being invoked with a nil pod.
+func TestStateMemoryUnclassifiedPodDefaultsToUser(t *testing.T) {
+	classifierCalled := false
+	classifier := func(pod *v1.Pod) PodClass {
+		classifierCalled = true
+		return PodClassPlatform
+	}
+	s := NewStateMemory(nil, classifier)
+
+	podUID := types.UID("pod-a")
+	if err := s.SetContainerResources(podUID, "c1", v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: cpuQuantity("1")},
+	}); err != nil {
+		t.Fatalf("SetContainerResources() returned error: %v", err)
+	}
+
+	if classifierCalled {
+		t.Errorf("classifier was invoked, want it never called without an explicit SetPodClass")
+	}
+	if got := s.GetReservedResources(PodClassUser).Cpu().String(); got != "1" {
+		t.Errorf("GetReservedResources(PodClassUser) cpu = %s, want 1", got)
+	}
+	if got := s.GetReservedResources(PodClassPlatform).Cpu().String(); got != "0" {
+		t.Errorf("GetReservedResources(PodClassPlatform) cpu = %s, want 0", got)
+	}
+}
+
+// TestStateMemoryReaggregatesOnClassChange verifies that moving a pod
+// between classes subtracts its contribution from the old class and adds it
+// to the new one, rather than double-counting.
+func TestStateMemoryReaggregatesOnClassChange(t *testing.T) {
+	s := NewStateMemory(nil, nil)
+	podUID := types.UID("pod-a")
+
+	if err := s.SetContainerResources(podUID, "c1", v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: cpuQuantity("3")},
+	}); err != nil {
+		t.Fatalf("SetContainerResources() returned error: %v", err)
+	}
+	if got := s.GetReservedResources(PodClassUser).Cpu().String(); got != "3" {
+		t.Fatalf("GetReservedResources(PodClassUser) cpu = %s, want 3", got)
+	}
+
+	if err := s.SetPodClass(podUID, PodClassSystem); err != nil {
+		t.Fatalf("SetPodClass() returned error: %v", err)
+	}
+
+	if got := s.GetReservedResources(PodClassUser); len(got) != 0 {
+		t.Errorf("GetReservedResources(PodClassUser) = %v, want empty after reclassifying the only pod away", got)
+	}
+	if got := s.GetReservedResources(PodClassSystem).Cpu().String(); got != "3" {
+		t.Errorf("GetReservedResources(PodClassSystem) cpu = %s, want 3", got)
+	}
+}
+
+// TestStateMemoryClassifyPodInvokesClassifier verifies ClassifyPod is the
+// real entry point for the injected classifier: it runs the classifier
+// against the given pod, records the resulting class, and reaggregates.
+func TestStateMemoryClassifyPodInvokesClassifier(t *testing.T) {
+	classifier := func(pod *v1.Pod) PodClass {
+		if pod.Labels["platform"] == "true" {
+			return PodClassPlatform
+		}
+		return PodClassUser
+	}
+	s := NewStateMemory(nil, classifier)
+
+	pod := &v1.Pod{}
+	pod.UID = types.UID("pod-a")
+	pod.Labels = map[string]string{"platform": "true"}
+
+	class, err := s.ClassifyPod(pod)
+	if err != nil {
+		t.Fatalf("ClassifyPod() returned error: %v", err)
+	}
+	if class != PodClassPlatform {
+		t.Errorf("ClassifyPod() = %v, want PodClassPlatform", class)
+	}
+
+	if err := s.SetContainerResources(pod.UID, "c1", v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: cpuQuantity("1")},
+	}); err != nil {
+		t.Fatalf("SetContainerResources() returned error: %v", err)
+	}
+	if got := s.GetReservedResources(PodClassPlatform).Cpu().String(); got != "1" {
+		t.Errorf("GetReservedResources(PodClassPlatform) cpu = %s, want 1 (ClassifyPod's result should stick)", got)
+	}
+}
+
+// TestStateMemoryGetReservedLimits verifies limits are aggregated per class
+// alongside requests and exposed through their own accessor.
+func TestStateMemoryGetReservedLimits(t *testing.T) {
+	s := NewStateMemory(nil, nil)
+	podUID := types.UID("pod-a")
+
+	if err := s.SetContainerResources(podUID, "c1", v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: cpuQuantity("1")},
+		Limits:   v1.ResourceList{v1.ResourceCPU: cpuQuantity("2")},
+	}); err != nil {
+		t.Fatalf("SetContainerResources() returned error: %v", err)
+	}
+
+	if got := s.GetReservedLimits(PodClassUser).Cpu().String(); got != "2" {
+		t.Errorf("GetReservedLimits(PodClassUser) cpu = %s, want 2", got)
+	}
+	if err := s.Delete(podUID, ""); err != nil {
+		t.Fatalf("Delete() returned error: %v", err)
+	}
+	if got := s.GetReservedLimits(PodClassUser); len(got) != 0 {
+		t.Errorf("GetReservedLimits(PodClassUser) = %v, want empty after delete", got)
+	}
+}
+
+// TestStateMemoryDeleteRemovesClassAggregation verifies a deleted pod's
+// contribution is fully removed from its class totals.
+func TestStateMemoryDeleteRemovesClassAggregation(t *testing.T) {
+	s := NewStateMemory(nil, nil)
+	podUID := types.UID("pod-a")
+
+	if err := s.SetPodClass(podUID, PodClassPlatform); err != nil {
+		t.Fatalf("SetPodClass() returned error: %v", err)
+	}
+	if err := s.SetContainerResources(podUID, "c1", v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: cpuQuantity("2")},
+	}); err != nil {
+		t.Fatalf("SetContainerResources() returned error: %v", err)
+	}
+	if err := s.Delete(podUID, ""); err != nil {
+		t.Fatalf("Delete() returned error: %v", err)
+	}
+
+	if got := s.GetReservedResources(PodClassPlatform); len(got) != 0 {
+		t.Errorf("GetReservedResources(PodClassPlatform) = %v, want empty after delete", got)
+	}
+}
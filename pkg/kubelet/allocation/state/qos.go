@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+var supportedQoSComputeResources = sets.NewString(string(v1.ResourceCPU), string(v1.ResourceMemory))
+
+// ComputeQoS derives the v1.PodQOSClass implied by a PodResourceInfo. When
+// PodLevelResources carries any requests or limits, it alone determines the
+// class, matching how the API server classifies pods that set pod-level
+// resources. Otherwise the class is computed by aggregating
+// ContainerResources, mirroring the well-known per-container QoS algorithm.
+func ComputeQoS(info PodResourceInfo) v1.PodQOSClass {
+	if len(info.PodLevelResources.Requests) > 0 || len(info.PodLevelResources.Limits) > 0 {
+		return qosFromResourceLists([]v1.ResourceRequirements{info.PodLevelResources})
+	}
+
+	resourceReqs := make([]v1.ResourceRequirements, 0, len(info.ContainerResources))
+	for _, containerResources := range info.ContainerResources {
+		resourceReqs = append(resourceReqs, containerResources)
+	}
+	return qosFromResourceLists(resourceReqs)
+}
+
+// qosFromResourceLists implements the standard QoS classification: Guaranteed
+// when every supported resource has matching, non-zero requests and limits
+// across all of reqs; BestEffort when none of them set anything; Burstable
+// otherwise.
+func qosFromResourceLists(reqs []v1.ResourceRequirements) v1.PodQOSClass {
+	requests := v1.ResourceList{}
+	limits := v1.ResourceList{}
+	zeroQuantity := resource.MustParse("0")
+	isGuaranteed := true
+
+	for _, r := range reqs {
+		for name, quantity := range r.Requests {
+			if !supportedQoSComputeResources.Has(string(name)) {
+				continue
+			}
+			if quantity.Cmp(zeroQuantity) == 1 {
+				delta := quantity.DeepCopy()
+				if _, exists := requests[name]; !exists {
+					requests[name] = delta
+				} else {
+					delta.Add(requests[name])
+					requests[name] = delta
+				}
+			}
+		}
+
+		qosLimitsFound := sets.NewString()
+		for name, quantity := range r.Limits {
+			if !supportedQoSComputeResources.Has(string(name)) {
+				continue
+			}
+			if quantity.Cmp(zeroQuantity) == 1 {
+				qosLimitsFound.Insert(string(name))
+				delta := quantity.DeepCopy()
+				if _, exists := limits[name]; !exists {
+					limits[name] = delta
+				} else {
+					delta.Add(limits[name])
+					limits[name] = delta
+				}
+			}
+		}
+
+		if !qosLimitsFound.HasAll(string(v1.ResourceMemory), string(v1.ResourceCPU)) {
+			isGuaranteed = false
+		}
+	}
+
+	if len(requests) == 0 && len(limits) == 0 {
+		return v1.PodQOSBestEffort
+	}
+
+	if isGuaranteed {
+		for name, req := range requests {
+			if lim, exists := limits[name]; !exists || lim.Cmp(req) != 0 {
+				isGuaranteed = false
+				break
+			}
+		}
+	}
+
+	if isGuaranteed && len(requests) == len(limits) {
+		return v1.PodQOSGuaranteed
+	}
+	return v1.PodQOSBurstable
+}
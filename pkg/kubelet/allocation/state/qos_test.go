@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestComputeQoS(t *testing.T) {
+	cpu := func(v string) v1.ResourceList {
+		return v1.ResourceList{v1.ResourceCPU: resource.MustParse(v)}
+	}
+	cpuMem := func(cpuVal, memVal string) v1.ResourceList {
+		return v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse(cpuVal),
+			v1.ResourceMemory: resource.MustParse(memVal),
+		}
+	}
+
+	tests := []struct {
+		name string
+		info PodResourceInfo
+		want v1.PodQOSClass
+	}{
+		{
+			name: "no resources anywhere is best effort",
+			info: PodResourceInfo{},
+			want: v1.PodQOSBestEffort,
+		},
+		{
+			name: "pod level requests equal limits is guaranteed",
+			info: PodResourceInfo{
+				PodLevelResources: v1.ResourceRequirements{
+					Requests: cpuMem("1", "1Gi"),
+					Limits:   cpuMem("1", "1Gi"),
+				},
+			},
+			want: v1.PodQOSGuaranteed,
+		},
+		{
+			name: "pod level requests below limits is burstable",
+			info: PodResourceInfo{
+				PodLevelResources: v1.ResourceRequirements{
+					Requests: cpuMem("1", "1Gi"),
+					Limits:   cpuMem("2", "2Gi"),
+				},
+			},
+			want: v1.PodQOSBurstable,
+		},
+		{
+			name: "pod level resources take precedence over container resources",
+			info: PodResourceInfo{
+				PodLevelResources: v1.ResourceRequirements{
+					Requests: cpuMem("1", "1Gi"),
+					Limits:   cpuMem("1", "1Gi"),
+				},
+				ContainerResources: map[string]v1.ResourceRequirements{
+					"c1": {Requests: cpu("1"), Limits: cpu("2")},
+				},
+			},
+			want: v1.PodQOSGuaranteed,
+		},
+		{
+			name: "single container guaranteed",
+			info: PodResourceInfo{
+				ContainerResources: map[string]v1.ResourceRequirements{
+					"c1": {Requests: cpuMem("1", "1Gi"), Limits: cpuMem("1", "1Gi")},
+				},
+			},
+			want: v1.PodQOSGuaranteed,
+		},
+		{
+			name: "one of several containers missing limits is burstable",
+			info: PodResourceInfo{
+				ContainerResources: map[string]v1.ResourceRequirements{
+					"c1": {Requests: cpuMem("1", "1Gi"), Limits: cpuMem("1", "1Gi")},
+					"c2": {Requests: cpu("1")},
+				},
+			},
+			want: v1.PodQOSBurstable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ComputeQoS(test.info); got != test.want {
+				t.Errorf("ComputeQoS() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ResizeStatus represents where a resize attempt is in its lifecycle.
+type ResizeStatus string
+
+const (
+	// ResizeStatusProposed means the resize has been recorded but not yet applied.
+	ResizeStatusProposed ResizeStatus = "Proposed"
+	// ResizeStatusApplied means the new resources have been applied to the pod.
+	ResizeStatusApplied ResizeStatus = "Applied"
+	// ResizeStatusRejected means the resize was not accepted (e.g. by admission).
+	ResizeStatusRejected ResizeStatus = "Rejected"
+	// ResizeStatusFailed means applying the resize to the running containers failed.
+	ResizeStatusFailed ResizeStatus = "Failed"
+)
+
+// maxResizeHistory bounds the per-pod resize ring buffer so a pod that is
+// resized repeatedly cannot grow the checkpoint without bound.
+const maxResizeHistory = 16
+
+// ResizeDecision is returned by ProposeResize and records the target
+// resources alongside the status the store assigned to the attempt.
+// ProposeResize only ever records a proposal, never rejects one, so Status
+// is always ResizeStatusProposed; admission plugins that want to reject a
+// flapping resize do so by calling CommitResize with ResizeStatusRejected
+// and a reason, not by examining this decision.
+type ResizeDecision struct {
+	PodUID types.UID
+	Target PodResourceInfo
+	Status ResizeStatus
+}
+
+// ResizeRecord is a single entry in a pod's resize history, capturing what
+// was requested, what (if anything) was actually applied, and the outcome.
+type ResizeRecord struct {
+	Timestamp time.Time
+	Requested PodResourceInfo
+	Applied   PodResourceInfo
+	Status    ResizeStatus
+	Reason    string
+}
+
+// appendResizeRecord appends record to history, trimming from the front once
+// maxResizeHistory is exceeded so the buffer behaves as a ring.
+func appendResizeRecord(history []ResizeRecord, record ResizeRecord) []ResizeRecord {
+	history = append(history, record)
+	if len(history) > maxResizeHistory {
+		history = history[len(history)-maxResizeHistory:]
+	}
+	return history
+}
+
+// supersedePendingProposals resolves every still-Proposed entry in history
+// as Rejected with reason, so a pod that is proposed again before a prior
+// proposal is committed never leaves a stale Proposed row with no recorded
+// outcome. Callers must still append the new proposal themselves; this only
+// guarantees at most one unresolved Proposed entry exists beforehand, which
+// commitResizeRecord relies on to find the right entry to update.
+func supersedePendingProposals(history []ResizeRecord, reason string) []ResizeRecord {
+	for i := range history {
+		if history[i].Status == ResizeStatusProposed {
+			history[i].Status = ResizeStatusRejected
+			history[i].Reason = reason
+		}
+	}
+	return history
+}
+
+// commitResizeRecord applies the outcome of a resize to history. It updates
+// the most recent ResizeStatusProposed entry in place, preserving its
+// original Requested value and Timestamp, so the record reflects what was
+// actually proposed rather than whatever the caller passed as applied. If no
+// matching Proposed entry exists (a commit with no prior propose), a new
+// record is appended with applied standing in for both Requested and Applied.
+func commitResizeRecord(history []ResizeRecord, applied PodResourceInfo, status ResizeStatus, reason string) []ResizeRecord {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Status == ResizeStatusProposed {
+			history[i].Applied = applied
+			history[i].Status = status
+			history[i].Reason = reason
+			return history
+		}
+	}
+	return appendResizeRecord(history, ResizeRecord{
+		Timestamp: time.Now(),
+		Requested: applied,
+		Applied:   applied,
+		Status:    status,
+		Reason:    reason,
+	})
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestAppendResizeRecordTrimsToMax(t *testing.T) {
+	var history []ResizeRecord
+	for i := 0; i < maxResizeHistory+5; i++ {
+		history = appendResizeRecord(history, ResizeRecord{Status: ResizeStatusProposed})
+	}
+	if len(history) != maxResizeHistory {
+		t.Errorf("len(history) = %d, want %d", len(history), maxResizeHistory)
+	}
+}
+
+// TestCommitResizeRecordMergesIntoProposed verifies that committing a resize
+// updates the last Proposed entry in place, preserving its Requested value
+// and Timestamp rather than synthesizing a new record from applied.
+func TestCommitResizeRecordMergesIntoProposed(t *testing.T) {
+	requested := PodResourceInfo{
+		ContainerResources: map[string]v1.ResourceRequirements{
+			"c1": {Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")}},
+		},
+	}
+	proposedAt := time.Now().Add(-time.Minute)
+	history := []ResizeRecord{{
+		Timestamp: proposedAt,
+		Requested: requested,
+		Status:    ResizeStatusProposed,
+	}}
+
+	applied := PodResourceInfo{
+		ContainerResources: map[string]v1.ResourceRequirements{
+			"c1": {Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")}},
+		},
+	}
+	history = commitResizeRecord(history, applied, ResizeStatusApplied, "admitted")
+
+	if len(history) != 1 {
+		t.Fatalf("len(history) = %d, want 1", len(history))
+	}
+	record := history[0]
+	if !record.Timestamp.Equal(proposedAt) {
+		t.Errorf("Timestamp = %v, want original propose time %v", record.Timestamp, proposedAt)
+	}
+	if record.Status != ResizeStatusApplied {
+		t.Errorf("Status = %v, want %v", record.Status, ResizeStatusApplied)
+	}
+	if record.Reason != "admitted" {
+		t.Errorf("Reason = %q, want %q", record.Reason, "admitted")
+	}
+	if got := record.Requested.ContainerResources["c1"].Requests.Cpu().String(); got != "2" {
+		t.Errorf("Requested cpu = %s, want 2 (unchanged from propose)", got)
+	}
+}
+
+// TestCommitResizeRecordRejectedPreservesRequested is the scenario the
+// feature exists for: an admission plugin rejecting a flapping resize must
+// still see the real requested target, not whatever it passed as applied.
+func TestCommitResizeRecordRejectedPreservesRequested(t *testing.T) {
+	requested := PodResourceInfo{
+		ContainerResources: map[string]v1.ResourceRequirements{
+			"c1": {Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}},
+		},
+	}
+	history := []ResizeRecord{{
+		Requested: requested,
+		Status:    ResizeStatusProposed,
+	}}
+
+	history = commitResizeRecord(history, PodResourceInfo{}, ResizeStatusRejected, "flapping")
+
+	if len(history) != 1 {
+		t.Fatalf("len(history) = %d, want 1", len(history))
+	}
+	if got := history[0].Requested.ContainerResources["c1"].Requests.Cpu().String(); got != "4" {
+		t.Errorf("Requested cpu = %s, want 4 (the real proposal, not the zero-value applied)", got)
+	}
+	if history[0].Status != ResizeStatusRejected {
+		t.Errorf("Status = %v, want %v", history[0].Status, ResizeStatusRejected)
+	}
+}
+
+// TestCommitResizeRecordWithoutPriorProposeAppends covers a commit with no
+// matching Proposed entry in history, which should append rather than panic
+// or silently drop the commit.
+func TestCommitResizeRecordWithoutPriorProposeAppends(t *testing.T) {
+	applied := PodResourceInfo{
+		ContainerResources: map[string]v1.ResourceRequirements{
+			"c1": {Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}},
+		},
+	}
+	history := commitResizeRecord(nil, applied, ResizeStatusApplied, "")
+
+	if len(history) != 1 {
+		t.Fatalf("len(history) = %d, want 1", len(history))
+	}
+	if history[0].Status != ResizeStatusApplied {
+		t.Errorf("Status = %v, want %v", history[0].Status, ResizeStatusApplied)
+	}
+}
+
+// TestStateMemoryCommitResizeAppliesAllocation verifies CommitResize updates
+// the pod's allocated resources only when status is ResizeStatusApplied.
+func TestStateMemoryCommitResizeAppliesAllocation(t *testing.T) {
+	s := NewStateMemory(nil, nil)
+	podUID := types.UID("pod-a")
+
+	target := PodResourceInfo{
+		ContainerResources: map[string]v1.ResourceRequirements{
+			"c1": {Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")}},
+		},
+	}
+	if _, err := s.ProposeResize(podUID, target); err != nil {
+		t.Fatalf("ProposeResize() returned error: %v", err)
+	}
+
+	if err := s.CommitResize(podUID, PodResourceInfo{}, ResizeStatusRejected, "denied"); err != nil {
+		t.Fatalf("CommitResize() returned error: %v", err)
+	}
+	if got, ok := s.GetContainerResources(podUID, "c1"); ok && len(got.Requests) != 0 {
+		t.Errorf("GetContainerResources() = %v, want unchanged after a rejected resize", got)
+	}
+
+	if _, err := s.ProposeResize(podUID, target); err != nil {
+		t.Fatalf("ProposeResize() returned error: %v", err)
+	}
+	if err := s.CommitResize(podUID, target, ResizeStatusApplied, ""); err != nil {
+		t.Fatalf("CommitResize() returned error: %v", err)
+	}
+	got, _ := s.GetContainerResources(podUID, "c1")
+	if got.Requests.Cpu().String() != "2" {
+		t.Errorf("GetContainerResources() cpu = %s, want 2 after an applied resize", got.Requests.Cpu().String())
+	}
+}
+
+// TestProposeResizeSupersedesStalePendingProposal covers the flapping-resize
+// scenario: proposing again before the prior proposal is committed must not
+// leave the earlier entry stuck at Proposed forever, since that is exactly
+// the history an admission plugin would inspect to detect flapping.
+func TestProposeResizeSupersedesStalePendingProposal(t *testing.T) {
+	s := NewStateMemory(nil, nil)
+	podUID := types.UID("pod-a")
+
+	first := PodResourceInfo{
+		ContainerResources: map[string]v1.ResourceRequirements{
+			"c1": {Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")}},
+		},
+	}
+	second := PodResourceInfo{
+		ContainerResources: map[string]v1.ResourceRequirements{
+			"c1": {Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}},
+		},
+	}
+
+	if _, err := s.ProposeResize(podUID, first); err != nil {
+		t.Fatalf("ProposeResize() returned error: %v", err)
+	}
+	if _, err := s.ProposeResize(podUID, second); err != nil {
+		t.Fatalf("ProposeResize() returned error: %v", err)
+	}
+
+	history := s.GetResizeHistory(podUID)
+	if len(history) != 2 {
+		t.Fatalf("len(history) = %d, want 2", len(history))
+	}
+	if history[0].Status != ResizeStatusRejected {
+		t.Errorf("history[0].Status = %v, want %v (superseded by the second proposal)", history[0].Status, ResizeStatusRejected)
+	}
+	if history[1].Status != ResizeStatusProposed {
+		t.Errorf("history[1].Status = %v, want %v", history[1].Status, ResizeStatusProposed)
+	}
+
+	if err := s.CommitResize(podUID, second, ResizeStatusApplied, ""); err != nil {
+		t.Fatalf("CommitResize() returned error: %v", err)
+	}
+	history = s.GetResizeHistory(podUID)
+	if history[1].Status != ResizeStatusApplied {
+		t.Errorf("history[1].Status after commit = %v, want %v", history[1].Status, ResizeStatusApplied)
+	}
+	if history[1].Requested.ContainerResources["c1"].Requests.Cpu().String() != "4" {
+		t.Errorf("history[1].Requested cpu = %s, want 4 (the live proposal, not the superseded one)",
+			history[1].Requested.ContainerResources["c1"].Requests.Cpu().String())
+	}
+}
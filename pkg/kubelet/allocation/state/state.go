@@ -50,6 +50,20 @@ type Reader interface {
 	GetContainerResources(podUID types.UID, containerName string) (v1.ResourceRequirements, bool)
 	GetPodLevelResources(podUID types.UID) v1.ResourceRequirements
 	GetPodResourceInfoMap() PodResourceInfoMap
+	// GetPodQoS returns the QoS class computed from the stored pod-level
+	// resources when set, falling back to the stored container resources
+	// otherwise. This gives every caller (resize, admission, eviction,
+	// CPU/memory managers) a single, consistent answer.
+	GetPodQoS(podUID types.UID) v1.PodQOSClass
+	// GetResizeHistory returns the pod's recorded resize attempts, oldest
+	// first, bounded to the last maxResizeHistory entries.
+	GetResizeHistory(podUID types.UID) []ResizeRecord
+	// GetReservedResources returns the aggregated requests currently
+	// allocated to pods of the given class.
+	GetReservedResources(class PodClass) v1.ResourceList
+	// GetReservedLimits returns the aggregated limits currently allocated to
+	// pods of the given class, mirroring GetReservedResources.
+	GetReservedLimits(class PodClass) v1.ResourceList
 }
 
 type writer interface {
@@ -59,10 +73,48 @@ type writer interface {
 	Delete(podUID types.UID, containerName string) error
 	// RemoveOrphanedPods removes the stored state for any pods not included in the set of remaining pods.
 	RemoveOrphanedPods(remainingPods sets.Set[types.UID])
+	// ProposeResize records a requested resize as Proposed in the pod's
+	// resize history and returns the resulting decision. It does not change
+	// the pod's allocated resources; callers apply the target and report the
+	// outcome through CommitResize.
+	ProposeResize(podUID types.UID, target PodResourceInfo) (ResizeDecision, error)
+	// CommitResize records the outcome of a previously proposed resize,
+	// updating the pod's most recent Proposed history entry in place so its
+	// original Requested value and timestamp are preserved. When status is
+	// ResizeStatusApplied, applied also becomes the pod's new allocated
+	// resources.
+	CommitResize(podUID types.UID, applied PodResourceInfo, status ResizeStatus, reason string) error
+	// SetPodClass records which PodClass podUID belongs to for the purposes
+	// of GetReservedResources accounting.
+	SetPodClass(podUID types.UID, class PodClass) error
+	// ClassifyPod runs the injected ClassifierFunc against pod, records the
+	// resulting PodClass for pod.UID, and returns it, so the label/namespace
+	// rules the classifier encodes take effect without the caller having to
+	// call SetPodClass itself.
+	ClassifyPod(pod *v1.Pod) (PodClass, error)
+}
+
+// Notifier lets callers subscribe to pod resource allocation change events
+// instead of polling GetPodResourceInfoMap on a timer, e.g. for event-driven
+// cgroup reconciliation.
+type Notifier interface {
+	// Subscribe registers name as a new subscriber, replacing any previous
+	// subscriber of the same name, and returns its event channel along with
+	// a function to unsubscribe and close the channel.
+	Subscribe(name string) (<-chan ResourceEvent, func())
+	// Replay emits a synthetic EventAdded for every pod currently tracked to
+	// the named subscriber, so a subscriber that joined late can build a
+	// consistent starting view before consuming live events.
+	Replay(name string)
+	// MissedEvents returns how many events have been dropped for the named
+	// subscriber because its channel was full; callers typically surface
+	// this as a metric.
+	MissedEvents(name string) uint64
 }
 
 // State interface provides methods for tracking and setting pod resource allocation
 type State interface {
 	Reader
 	writer
+	Notifier
 }
@@ -0,0 +1,357 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/kubelet/checkpointmanager"
+	"k8s.io/kubernetes/pkg/kubelet/checkpointmanager/checksum"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// checkpointVersion is the current schema version of the checkpoint written
+// by stateCheckpoint. Bump this whenever the on-disk representation changes
+// and add an upgrade step in migrateCheckpoint.
+const checkpointVersion = "v1"
+
+// PodResourceAllocationCheckpoint is the on-disk representation of a
+// PodResourceInfoMap, versioned so that older checkpoints can be detected
+// and migrated forward.
+type PodResourceAllocationCheckpoint struct {
+	Version       string                        `json:"version"`
+	PodInfoMap    map[types.UID]PodResourceInfo `json:"podResourceInfoMap"`
+	ResizeHistory map[types.UID][]ResizeRecord  `json:"resizeHistory,omitempty"`
+	PodClass      map[types.UID]PodClass        `json:"podClass,omitempty"`
+	Checksum      checksum.Checksum             `json:"checksum"`
+}
+
+// podClassSnapshotter is implemented by stateMemory so stateCheckpoint can
+// read its explicit pod-class assignments for checkpointing without
+// widening the public State interface.
+type podClassSnapshotter interface {
+	snapshotPodClass() map[types.UID]PodClass
+}
+
+// resizeHistoryRestorer is implemented by stateMemory so stateCheckpoint can
+// install historical resize records verbatim on restore, preserving their
+// original Timestamp instead of re-stamping them through ProposeResize /
+// CommitResize.
+type resizeHistoryRestorer interface {
+	restoreResizeHistory(history map[types.UID][]ResizeRecord)
+}
+
+// MarshalCheckpoint returns the JSON encoding of the checkpoint after
+// (re)computing its checksum over the entire checkpoint contents.
+func (pc *PodResourceAllocationCheckpoint) MarshalCheckpoint() ([]byte, error) {
+	pc.Checksum = 0
+	// Checksum the checkpoint as it will read back from JSON: timestamps and
+	// quantities do not keep their in-memory representation across a round
+	// trip, so VerifyChecksum on the restored copy would otherwise fail.
+	blob, err := json.Marshal(*pc)
+	if err != nil {
+		return nil, err
+	}
+	decoded := PodResourceAllocationCheckpoint{}
+	if err := json.Unmarshal(blob, &decoded); err != nil {
+		return nil, err
+	}
+	pc.Checksum = checksum.New(decoded)
+	return json.Marshal(*pc)
+}
+
+// UnmarshalCheckpoint restores the checkpoint from its JSON encoding.
+func (pc *PodResourceAllocationCheckpoint) UnmarshalCheckpoint(blob []byte) error {
+	return json.Unmarshal(blob, pc)
+}
+
+// VerifyChecksum validates the checkpoint's stored checksum against its
+// entire contents, rejecting partially written or corrupted checkpoints.
+func (pc *PodResourceAllocationCheckpoint) VerifyChecksum() error {
+	ck := pc.Checksum
+	pc.Checksum = 0
+	err := ck.Verify(*pc)
+	pc.Checksum = ck
+	return err
+}
+
+// stateCheckpoint wraps an in-memory stateMemory with a checkpointmanager
+// backed persistence layer, so pod-level and container-level
+// ResourceRequirements survive a kubelet restart.
+type stateCheckpoint struct {
+	mux               sync.RWMutex
+	cache             State
+	checkpointManager checkpointmanager.CheckpointManager
+	checkpointName    string
+}
+
+var _ State = &stateCheckpoint{}
+
+// NewStateCheckpoint creates a State backed by a checkpoint file named
+// checkpointName inside stateDir. The store is seeded with initial, and any
+// previously persisted allocations are then restored over it.
+// classifier is forwarded to the underlying in-memory store; see
+// NewStateMemory.
+func NewStateCheckpoint(stateDir, checkpointName string, initial PodResourceInfoMap, classifier ClassifierFunc) (State, error) {
+	checkpointManager, err := checkpointmanager.NewCheckpointManager(stateDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize checkpoint manager: %w", err)
+	}
+
+	sc := &stateCheckpoint{
+		cache:             NewStateMemory(initial, classifier),
+		checkpointManager: checkpointManager,
+		checkpointName:    checkpointName,
+	}
+
+	if err := sc.restoreState(); err != nil {
+		//nolint:staticcheck // ST1005 user-facing error message
+		return nil, fmt.Errorf("could not restore state from checkpoint: %w, please drain this node and delete the pod resource allocation checkpoint file %q before restarting Kubelet",
+			err, path.Join(stateDir, checkpointName))
+	}
+
+	return sc, nil
+}
+
+// restoreState loads the checkpoint from disk, migrating it to the current
+// schema version if needed, and seeds the in-memory cache with its contents.
+// A missing checkpoint is not an error: it means this is the first run.
+func (sc *stateCheckpoint) restoreState() error {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+
+	checkpoint := &PodResourceAllocationCheckpoint{}
+	if err := sc.checkpointManager.GetCheckpoint(sc.checkpointName, checkpoint); err != nil {
+		if err == checkpointmanager.ErrCheckpointNotFound {
+			return sc.storeStateLocked()
+		}
+		return err
+	}
+
+	podInfoMap, err := migrateCheckpoint(checkpoint)
+	if err != nil {
+		return fmt.Errorf("unable to migrate checkpoint of version %q: %w", checkpoint.Version, err)
+	}
+
+	for podUID, podInfo := range podInfoMap {
+		if err := sc.cache.SetPodResourceInfoMap(podUID, podInfo); err != nil {
+			return err
+		}
+	}
+	if restorer, ok := sc.cache.(resizeHistoryRestorer); ok {
+		restorer.restoreResizeHistory(checkpoint.ResizeHistory)
+	}
+	for podUID, class := range checkpoint.PodClass {
+		if err := sc.cache.SetPodClass(podUID, class); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateCheckpoint upgrades older checkpoint schemas to the current
+// PodResourceInfoMap representation. Checkpoints written before pod-level
+// resources existed only ever populated ContainerResources, which already
+// unmarshals cleanly into PodResourceInfo, so there is nothing to rewrite
+// today; this is the hook future schema changes should extend.
+func migrateCheckpoint(checkpoint *PodResourceAllocationCheckpoint) (PodResourceInfoMap, error) {
+	switch checkpoint.Version {
+	case checkpointVersion, "":
+		return PodResourceInfoMap(checkpoint.PodInfoMap), nil
+	default:
+		return nil, fmt.Errorf("unknown checkpoint version %q", checkpoint.Version)
+	}
+}
+
+// storeStateLocked writes the current contents of the cache to the
+// checkpoint file. Callers must hold sc.mux.
+func (sc *stateCheckpoint) storeStateLocked() error {
+	podInfoMap := sc.cache.GetPodResourceInfoMap()
+	resizeHistory := make(map[types.UID][]ResizeRecord, len(podInfoMap))
+	for podUID := range podInfoMap {
+		if history := sc.cache.GetResizeHistory(podUID); len(history) > 0 {
+			resizeHistory[podUID] = history
+		}
+	}
+
+	var podClass map[types.UID]PodClass
+	if snapshotter, ok := sc.cache.(podClassSnapshotter); ok {
+		podClass = snapshotter.snapshotPodClass()
+	}
+
+	checkpoint := &PodResourceAllocationCheckpoint{
+		Version:       checkpointVersion,
+		PodInfoMap:    podInfoMap,
+		ResizeHistory: resizeHistory,
+		PodClass:      podClass,
+	}
+	if err := sc.checkpointManager.CreateCheckpoint(sc.checkpointName, checkpoint); err != nil {
+		klog.ErrorS(err, "Failed to save pod resource allocation checkpoint")
+		return err
+	}
+	return nil
+}
+
+func (sc *stateCheckpoint) GetContainerResources(podUID types.UID, containerName string) (v1.ResourceRequirements, bool) {
+	sc.mux.RLock()
+	defer sc.mux.RUnlock()
+	return sc.cache.GetContainerResources(podUID, containerName)
+}
+
+func (sc *stateCheckpoint) GetPodLevelResources(podUID types.UID) v1.ResourceRequirements {
+	sc.mux.RLock()
+	defer sc.mux.RUnlock()
+	return sc.cache.GetPodLevelResources(podUID)
+}
+
+func (sc *stateCheckpoint) GetPodResourceInfoMap() PodResourceInfoMap {
+	sc.mux.RLock()
+	defer sc.mux.RUnlock()
+	return sc.cache.GetPodResourceInfoMap()
+}
+
+func (sc *stateCheckpoint) GetPodQoS(podUID types.UID) v1.PodQOSClass {
+	sc.mux.RLock()
+	defer sc.mux.RUnlock()
+	return sc.cache.GetPodQoS(podUID)
+}
+
+func (sc *stateCheckpoint) GetResizeHistory(podUID types.UID) []ResizeRecord {
+	sc.mux.RLock()
+	defer sc.mux.RUnlock()
+	return sc.cache.GetResizeHistory(podUID)
+}
+
+func (sc *stateCheckpoint) ProposeResize(podUID types.UID, target PodResourceInfo) (ResizeDecision, error) {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	decision, err := sc.cache.ProposeResize(podUID, target)
+	if err != nil {
+		return decision, err
+	}
+	return decision, sc.storeStateLocked()
+}
+
+func (sc *stateCheckpoint) CommitResize(podUID types.UID, applied PodResourceInfo, status ResizeStatus, reason string) error {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	if err := sc.cache.CommitResize(podUID, applied, status, reason); err != nil {
+		return err
+	}
+	return sc.storeStateLocked()
+}
+
+func (sc *stateCheckpoint) GetReservedResources(class PodClass) v1.ResourceList {
+	sc.mux.RLock()
+	defer sc.mux.RUnlock()
+	return sc.cache.GetReservedResources(class)
+}
+
+func (sc *stateCheckpoint) GetReservedLimits(class PodClass) v1.ResourceList {
+	sc.mux.RLock()
+	defer sc.mux.RUnlock()
+	return sc.cache.GetReservedLimits(class)
+}
+
+func (sc *stateCheckpoint) SetPodClass(podUID types.UID, class PodClass) error {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	if err := sc.cache.SetPodClass(podUID, class); err != nil {
+		return err
+	}
+	return sc.storeStateLocked()
+}
+
+func (sc *stateCheckpoint) ClassifyPod(pod *v1.Pod) (PodClass, error) {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	class, err := sc.cache.ClassifyPod(pod)
+	if err != nil {
+		return class, err
+	}
+	return class, sc.storeStateLocked()
+}
+
+func (sc *stateCheckpoint) Subscribe(name string) (<-chan ResourceEvent, func()) {
+	sc.mux.RLock()
+	defer sc.mux.RUnlock()
+	return sc.cache.Subscribe(name)
+}
+
+func (sc *stateCheckpoint) Replay(name string) {
+	sc.mux.RLock()
+	defer sc.mux.RUnlock()
+	sc.cache.Replay(name)
+}
+
+func (sc *stateCheckpoint) MissedEvents(name string) uint64 {
+	sc.mux.RLock()
+	defer sc.mux.RUnlock()
+	return sc.cache.MissedEvents(name)
+}
+
+func (sc *stateCheckpoint) SetContainerResources(podUID types.UID, containerName string, alloc v1.ResourceRequirements) error {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	if err := sc.cache.SetContainerResources(podUID, containerName, alloc); err != nil {
+		return err
+	}
+	return sc.storeStateLocked()
+}
+
+func (sc *stateCheckpoint) SetPodLevelResources(podUID types.UID, alloc v1.ResourceRequirements) error {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	if err := sc.cache.SetPodLevelResources(podUID, alloc); err != nil {
+		return err
+	}
+	return sc.storeStateLocked()
+}
+
+func (sc *stateCheckpoint) SetPodResourceInfoMap(podUID types.UID, alloc PodResourceInfo) error {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	if err := sc.cache.SetPodResourceInfoMap(podUID, alloc); err != nil {
+		return err
+	}
+	return sc.storeStateLocked()
+}
+
+func (sc *stateCheckpoint) Delete(podUID types.UID, containerName string) error {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	if err := sc.cache.Delete(podUID, containerName); err != nil {
+		return err
+	}
+	return sc.storeStateLocked()
+}
+
+func (sc *stateCheckpoint) RemoveOrphanedPods(remainingPods sets.Set[types.UID]) {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	sc.cache.RemoveOrphanedPods(remainingPods)
+	if err := sc.storeStateLocked(); err != nil {
+		klog.ErrorS(err, "Failed to checkpoint state after removing orphaned pods")
+	}
+}
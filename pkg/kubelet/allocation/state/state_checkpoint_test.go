@@ -0,0 +1,177 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestCheckpointMarshalRoundTrip(t *testing.T) {
+	checkpoint := &PodResourceAllocationCheckpoint{
+		Version: checkpointVersion,
+		PodInfoMap: map[types.UID]PodResourceInfo{
+			"pod-a": {
+				ContainerResources: map[string]v1.ResourceRequirements{
+					"c1": {Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}},
+				},
+			},
+		},
+		ResizeHistory: map[types.UID][]ResizeRecord{
+			"pod-a": {{Status: ResizeStatusProposed}},
+		},
+		PodClass: map[types.UID]PodClass{"pod-a": PodClassPlatform},
+	}
+
+	blob, err := checkpoint.MarshalCheckpoint()
+	if err != nil {
+		t.Fatalf("MarshalCheckpoint() returned error: %v", err)
+	}
+
+	restored := &PodResourceAllocationCheckpoint{}
+	if err := restored.UnmarshalCheckpoint(blob); err != nil {
+		t.Fatalf("UnmarshalCheckpoint() returned error: %v", err)
+	}
+	if err := restored.VerifyChecksum(); err != nil {
+		t.Fatalf("VerifyChecksum() returned error on an untouched checkpoint: %v", err)
+	}
+	if restored.PodClass["pod-a"] != PodClassPlatform {
+		t.Errorf("PodClass = %v, want PodClassPlatform", restored.PodClass["pod-a"])
+	}
+	if len(restored.ResizeHistory["pod-a"]) != 1 {
+		t.Errorf("ResizeHistory = %v, want 1 entry", restored.ResizeHistory["pod-a"])
+	}
+}
+
+// TestCheckpointVerifyChecksumCoversWholeStruct guards against the checksum
+// only covering PodInfoMap: corrupting ResizeHistory or PodClass after
+// marshaling must also be caught.
+func TestCheckpointVerifyChecksumCoversWholeStruct(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(c *PodResourceAllocationCheckpoint)
+	}{
+		{
+			name: "podInfoMap corrupted",
+			corrupt: func(c *PodResourceAllocationCheckpoint) {
+				c.PodInfoMap["pod-b"] = PodResourceInfo{}
+			},
+		},
+		{
+			name: "resizeHistory corrupted",
+			corrupt: func(c *PodResourceAllocationCheckpoint) {
+				c.ResizeHistory["pod-a"] = append(c.ResizeHistory["pod-a"], ResizeRecord{Status: ResizeStatusFailed})
+			},
+		},
+		{
+			name: "podClass corrupted",
+			corrupt: func(c *PodResourceAllocationCheckpoint) {
+				c.PodClass["pod-a"] = PodClassSystem
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkpoint := &PodResourceAllocationCheckpoint{
+				Version:       checkpointVersion,
+				PodInfoMap:    map[types.UID]PodResourceInfo{"pod-a": {}},
+				ResizeHistory: map[types.UID][]ResizeRecord{"pod-a": {{Status: ResizeStatusProposed}}},
+				PodClass:      map[types.UID]PodClass{"pod-a": PodClassPlatform},
+			}
+			if _, err := checkpoint.MarshalCheckpoint(); err != nil {
+				t.Fatalf("MarshalCheckpoint() returned error: %v", err)
+			}
+
+			test.corrupt(checkpoint)
+
+			if err := checkpoint.VerifyChecksum(); err == nil {
+				t.Errorf("VerifyChecksum() returned nil, want an error after corrupting the checkpoint")
+			}
+		})
+	}
+}
+
+func TestMigrateCheckpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		wantErr bool
+	}{
+		{name: "current version", version: checkpointVersion},
+		{name: "empty version treated as current", version: ""},
+		{name: "unknown version rejected", version: "v999", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkpoint := &PodResourceAllocationCheckpoint{
+				Version:    test.version,
+				PodInfoMap: map[types.UID]PodResourceInfo{"pod-a": {}},
+			}
+			_, err := migrateCheckpoint(checkpoint)
+			if (err != nil) != test.wantErr {
+				t.Errorf("migrateCheckpoint() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// TestStateCheckpointRestoresAcrossRestart verifies that a pod's resize
+// history, with its original timestamp and committed status, survives a
+// simulated kubelet restart.
+func TestStateCheckpointRestoresAcrossRestart(t *testing.T) {
+	stateDir := t.TempDir()
+
+	sc, err := NewStateCheckpoint(stateDir, "allocation_checkpoint", nil, nil)
+	if err != nil {
+		t.Fatalf("NewStateCheckpoint() returned error: %v", err)
+	}
+
+	podUID := types.UID("pod-a")
+	if err := sc.SetPodClass(podUID, PodClassPlatform); err != nil {
+		t.Fatalf("SetPodClass() returned error: %v", err)
+	}
+	if _, err := sc.ProposeResize(podUID, PodResourceInfo{}); err != nil {
+		t.Fatalf("ProposeResize() returned error: %v", err)
+	}
+	if err := sc.CommitResize(podUID, PodResourceInfo{}, ResizeStatusApplied, "looks good"); err != nil {
+		t.Fatalf("CommitResize() returned error: %v", err)
+	}
+	wantHistory := sc.GetResizeHistory(podUID)
+	if len(wantHistory) != 1 {
+		t.Fatalf("GetResizeHistory() = %v, want 1 entry", wantHistory)
+	}
+
+	// Simulate a kubelet restart by constructing a fresh store against the
+	// same directory.
+	restarted, err := NewStateCheckpoint(stateDir, "allocation_checkpoint", nil, nil)
+	if err != nil {
+		t.Fatalf("NewStateCheckpoint() after restart returned error: %v", err)
+	}
+
+	gotHistory := restarted.GetResizeHistory(podUID)
+	if len(gotHistory) != 1 || !gotHistory[0].Timestamp.Equal(wantHistory[0].Timestamp) {
+		t.Errorf("GetResizeHistory() after restart = %v, want timestamp preserved from %v", gotHistory, wantHistory)
+	}
+	if gotHistory[0].Status != ResizeStatusApplied {
+		t.Errorf("Status after restart = %v, want %v", gotHistory[0].Status, ResizeStatusApplied)
+	}
+}
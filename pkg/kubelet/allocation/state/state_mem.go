@@ -18,6 +18,7 @@ package state
 
 import (
 	"sync"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -27,20 +28,42 @@ import (
 
 type stateMemory struct {
 	sync.RWMutex
-	podInfoMap PodResourceInfoMap
+	podInfoMap       PodResourceInfoMap
+	resizeHistory    map[types.UID][]ResizeRecord
+	classifier       ClassifierFunc
+	podClass         map[types.UID]PodClass
+	podContributions map[types.UID]podContribution
+	classTotals      map[PodClass]resourceTotals
+	broadcaster      *eventBroadcaster
 }
 
 var _ State = &stateMemory{}
 
-// NewStateMemory creates new State to track resources allocated to pods
-func NewStateMemory(alloc PodResourceInfoMap) State {
+// NewStateMemory creates new State to track resources allocated to pods.
+// classifier is what ClassifyPod runs to determine a pod's PodClass; it
+// defaults to DefaultClassifier (every pod is PodClassUser) when nil. A pod
+// never passed to ClassifyPod or SetPodClass is aggregated as PodClassUser.
+func NewStateMemory(alloc PodResourceInfoMap, classifier ClassifierFunc) State {
 	if alloc == nil {
 		alloc = PodResourceInfoMap{}
 	}
+	if classifier == nil {
+		classifier = DefaultClassifier
+	}
 	klog.V(2).InfoS("Initialized new in-memory state store for pod resource allocation tracking")
-	return &stateMemory{
-		podInfoMap: alloc,
+	s := &stateMemory{
+		podInfoMap:       alloc,
+		resizeHistory:    make(map[types.UID][]ResizeRecord),
+		classifier:       classifier,
+		podClass:         make(map[types.UID]PodClass),
+		podContributions: make(map[types.UID]podContribution),
+		classTotals:      make(map[PodClass]resourceTotals),
+		broadcaster:      newEventBroadcaster(),
+	}
+	for podUID := range alloc {
+		s.reaggregateClassLocked(podUID)
 	}
+	return s
 }
 
 func (s *stateMemory) GetContainerResources(podUID types.UID, containerName string) (v1.ResourceRequirements, bool) {
@@ -64,6 +87,108 @@ func (s *stateMemory) GetPodResourceInfoMap() PodResourceInfoMap {
 	return s.podInfoMap.Clone()
 }
 
+func (s *stateMemory) GetPodQoS(podUID types.UID) v1.PodQOSClass {
+	s.RLock()
+	defer s.RUnlock()
+	return ComputeQoS(s.podInfoMap[podUID])
+}
+
+func (s *stateMemory) GetReservedResources(class PodClass) v1.ResourceList {
+	s.RLock()
+	defer s.RUnlock()
+	return s.classTotals[class].requests.DeepCopy()
+}
+
+func (s *stateMemory) GetReservedLimits(class PodClass) v1.ResourceList {
+	s.RLock()
+	defer s.RUnlock()
+	return s.classTotals[class].limits.DeepCopy()
+}
+
+func (s *stateMemory) SetPodClass(podUID types.UID, class PodClass) error {
+	s.Lock()
+	defer s.Unlock()
+	s.podClass[podUID] = class
+	s.reaggregateClassLocked(podUID)
+	klog.V(3).InfoS("Updated pod class", "podUID", podUID, "class", class)
+	return nil
+}
+
+// ClassifyPod runs the injected classifier against pod and records the
+// result, giving callers a way to classify a pod without first having to
+// invoke the classifier themselves and round-trip through SetPodClass.
+func (s *stateMemory) ClassifyPod(pod *v1.Pod) (PodClass, error) {
+	class := s.classifier(pod)
+
+	s.Lock()
+	defer s.Unlock()
+	s.podClass[pod.UID] = class
+	s.reaggregateClassLocked(pod.UID)
+	klog.V(3).InfoS("Classified pod", "podUID", pod.UID, "class", class)
+	return class, nil
+}
+
+// snapshotPodClass returns a copy of the explicit pod-class assignments, so
+// stateCheckpoint can persist them without this type needing to know
+// anything about checkpoints.
+func (s *stateMemory) snapshotPodClass() map[types.UID]PodClass {
+	s.RLock()
+	defer s.RUnlock()
+	classes := make(map[types.UID]PodClass, len(s.podClass))
+	for podUID, class := range s.podClass {
+		classes[podUID] = class
+	}
+	return classes
+}
+
+// classOfLocked returns the PodClass podUID is currently tracked under: the
+// class recorded by ClassifyPod or SetPodClass if any, otherwise
+// PodClassUser. It never invokes the injected classifier itself, since it
+// only has podUID, not the *v1.Pod the classifier needs; that happens in
+// ClassifyPod.
+func (s *stateMemory) classOfLocked(podUID types.UID) PodClass {
+	if class, ok := s.podClass[podUID]; ok {
+		return class
+	}
+	return PodClassUser
+}
+
+// reaggregateClassLocked recomputes podUID's contribution to its class
+// totals, removing any stale contribution first. Callers must hold the
+// write lock.
+func (s *stateMemory) reaggregateClassLocked(podUID types.UID) {
+	if old, ok := s.podContributions[podUID]; ok {
+		totals := s.classTotals[old.class]
+		subtractResourceListFrom(totals.requests, old.requests)
+		subtractResourceListFrom(totals.limits, old.limits)
+		s.classTotals[old.class] = totals
+	}
+
+	class := s.classOfLocked(podUID)
+	requests, limits := aggregateResources(s.podInfoMap[podUID])
+	totals, ok := s.classTotals[class]
+	if !ok {
+		totals = newResourceTotals()
+	}
+	addResourceListInto(totals.requests, requests)
+	addResourceListInto(totals.limits, limits)
+	s.classTotals[class] = totals
+	s.podContributions[podUID] = podContribution{class: class, requests: requests, limits: limits}
+}
+
+// removeClassAggregationLocked drops podUID's contribution entirely, used
+// when the pod's allocation is deleted. Callers must hold the write lock.
+func (s *stateMemory) removeClassAggregationLocked(podUID types.UID) {
+	if old, ok := s.podContributions[podUID]; ok {
+		totals := s.classTotals[old.class]
+		subtractResourceListFrom(totals.requests, old.requests)
+		subtractResourceListFrom(totals.limits, old.limits)
+		s.classTotals[old.class] = totals
+		delete(s.podContributions, podUID)
+	}
+	delete(s.podClass, podUID)
+}
+
 func (s *stateMemory) SetContainerResources(podUID types.UID, containerName string, alloc v1.ResourceRequirements) error {
 	s.Lock()
 	defer s.Unlock()
@@ -74,7 +199,21 @@ func (s *stateMemory) SetContainerResources(podUID types.UID, containerName stri
 		}
 	}
 
+	oldAlloc, hadOld := s.podInfoMap[podUID].ContainerResources[containerName]
 	s.podInfoMap[podUID].ContainerResources[containerName] = alloc
+	s.reaggregateClassLocked(podUID)
+
+	eventType := EventUpdated
+	if !hadOld {
+		eventType = EventAdded
+	}
+	s.broadcaster.publish(ResourceEvent{
+		PodUID:        podUID,
+		ContainerName: containerName,
+		OldResources:  PodResourceInfo{ContainerResources: map[string]v1.ResourceRequirements{containerName: *oldAlloc.DeepCopy()}},
+		NewResources:  PodResourceInfo{ContainerResources: map[string]v1.ResourceRequirements{containerName: *alloc.DeepCopy()}},
+		EventType:     eventType,
+	})
 	klog.V(3).InfoS("Updated container resource allocation", "podUID", podUID, "containerName", containerName, "alloc", alloc)
 	return nil
 }
@@ -86,9 +225,18 @@ func (s *stateMemory) SetPodLevelResources(podUID types.UID, alloc v1.ResourceRe
 		s.podInfoMap[podUID] = PodResourceInfo{PodLevelResources: v1.ResourceRequirements{}}
 	}
 
+	oldAlloc := s.podInfoMap[podUID].PodLevelResources
 	podInfo := s.podInfoMap[podUID]
 	podInfo.PodLevelResources = alloc
 	s.podInfoMap[podUID] = podInfo
+	s.reaggregateClassLocked(podUID)
+
+	s.broadcaster.publish(ResourceEvent{
+		PodUID:       podUID,
+		OldResources: PodResourceInfo{PodLevelResources: *oldAlloc.DeepCopy()},
+		NewResources: PodResourceInfo{PodLevelResources: *alloc.DeepCopy()},
+		EventType:    EventUpdated,
+	})
 	klog.V(3).InfoS("Updated pod level resources", "podUID", podUID, "allocation", alloc)
 	return nil
 }
@@ -96,17 +244,121 @@ func (s *stateMemory) SetPodLevelResources(podUID types.UID, alloc v1.ResourceRe
 func (s *stateMemory) SetPodResourceInfoMap(podUID types.UID, alloc PodResourceInfo) error {
 	s.Lock()
 	defer s.Unlock()
+	s.setPodResourceInfoMapLocked(podUID, alloc)
+	return nil
+}
 
+// setPodResourceInfoMapLocked sets the allocation for podUID. Callers must
+// hold the write lock.
+func (s *stateMemory) setPodResourceInfoMapLocked(podUID types.UID, alloc PodResourceInfo) {
+	old, hadOld := s.podInfoMap[podUID]
 	s.podInfoMap[podUID] = alloc
+	s.reaggregateClassLocked(podUID)
+
+	eventType := EventUpdated
+	if !hadOld {
+		eventType = EventAdded
+	}
+	s.broadcaster.publish(ResourceEvent{
+		PodUID:       podUID,
+		OldResources: clonePodResourceInfo(old),
+		NewResources: clonePodResourceInfo(alloc),
+		EventType:    eventType,
+	})
 	klog.V(3).InfoS("Updated pod resource allocation", "podUID", podUID, "allocation", alloc)
+}
+
+// clonePodResourceInfo returns a deep copy of info.
+func clonePodResourceInfo(info PodResourceInfo) PodResourceInfo {
+	clone := PodResourceInfo{
+		PodLevelResources:  *info.PodLevelResources.DeepCopy(),
+		ContainerResources: make(map[string]v1.ResourceRequirements, len(info.ContainerResources)),
+	}
+	for name, res := range info.ContainerResources {
+		clone.ContainerResources[name] = *res.DeepCopy()
+	}
+	return clone
+}
+
+func (s *stateMemory) Subscribe(name string) (<-chan ResourceEvent, func()) {
+	return s.broadcaster.subscribe(name)
+}
+
+func (s *stateMemory) Replay(name string) {
+	s.broadcaster.replay(name, s.GetPodResourceInfoMap())
+}
+
+func (s *stateMemory) MissedEvents(name string) uint64 {
+	return s.broadcaster.missed(name)
+}
+
+func (s *stateMemory) GetResizeHistory(podUID types.UID) []ResizeRecord {
+	s.RLock()
+	defer s.RUnlock()
+
+	history := s.resizeHistory[podUID]
+	historyCopy := make([]ResizeRecord, len(history))
+	copy(historyCopy, history)
+	return historyCopy
+}
+
+// restoreResizeHistory installs history verbatim, preserving each record's
+// original Timestamp. It is only used when restoring from a checkpoint;
+// live updates must go through ProposeResize/CommitResize instead.
+func (s *stateMemory) restoreResizeHistory(history map[types.UID][]ResizeRecord) {
+	s.Lock()
+	defer s.Unlock()
+	for podUID, records := range history {
+		s.resizeHistory[podUID] = records
+	}
+}
+
+func (s *stateMemory) ProposeResize(podUID types.UID, target PodResourceInfo) (ResizeDecision, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	decision := ResizeDecision{
+		PodUID: podUID,
+		Target: target,
+		Status: ResizeStatusProposed,
+	}
+	history := supersedePendingProposals(s.resizeHistory[podUID], "superseded by a newer resize proposal")
+	s.resizeHistory[podUID] = appendResizeRecord(history, ResizeRecord{
+		Timestamp: time.Now(),
+		Requested: target,
+		Status:    ResizeStatusProposed,
+	})
+	klog.V(3).InfoS("Proposed pod resize", "podUID", podUID, "target", target)
+	return decision, nil
+}
+
+func (s *stateMemory) CommitResize(podUID types.UID, applied PodResourceInfo, status ResizeStatus, reason string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.resizeHistory[podUID] = commitResizeRecord(s.resizeHistory[podUID], applied, status, reason)
+	if status == ResizeStatusApplied {
+		s.setPodResourceInfoMapLocked(podUID, applied)
+	}
+	klog.V(3).InfoS("Committed pod resize", "podUID", podUID, "applied", applied, "status", status, "reason", reason)
 	return nil
 }
 
 func (s *stateMemory) deleteContainer(podUID types.UID, containerName string) {
+	oldAlloc := s.podInfoMap[podUID].ContainerResources[containerName]
 	delete(s.podInfoMap[podUID].ContainerResources, containerName)
 	if len(s.podInfoMap[podUID].ContainerResources) == 0 {
 		delete(s.podInfoMap, podUID)
+		s.removeClassAggregationLocked(podUID)
+	} else {
+		s.reaggregateClassLocked(podUID)
 	}
+	s.broadcaster.publish(ResourceEvent{
+		PodUID:        podUID,
+		ContainerName: containerName,
+		OldResources:  PodResourceInfo{ContainerResources: map[string]v1.ResourceRequirements{containerName: *oldAlloc.DeepCopy()}},
+		EventType:     EventDeleted,
+	})
 	klog.V(3).InfoS("Deleted pod resource allocation", "podUID", podUID, "containerName", containerName)
 }
 
@@ -114,7 +366,15 @@ func (s *stateMemory) Delete(podUID types.UID, containerName string) error {
 	s.Lock()
 	defer s.Unlock()
 	if len(containerName) == 0 {
+		old := s.podInfoMap[podUID]
 		delete(s.podInfoMap, podUID)
+		delete(s.resizeHistory, podUID)
+		s.removeClassAggregationLocked(podUID)
+		s.broadcaster.publish(ResourceEvent{
+			PodUID:       podUID,
+			OldResources: clonePodResourceInfo(old),
+			EventType:    EventDeleted,
+		})
 		klog.V(3).InfoS("Deleted pod resource allocation and resize state", "podUID", podUID)
 		return nil
 	}
@@ -126,9 +386,16 @@ func (s *stateMemory) RemoveOrphanedPods(remainingPods sets.Set[types.UID]) {
 	s.Lock()
 	defer s.Unlock()
 
-	for podUID := range s.podInfoMap {
+	for podUID, info := range s.podInfoMap {
 		if _, ok := remainingPods[types.UID(podUID)]; !ok {
 			delete(s.podInfoMap, podUID)
+			delete(s.resizeHistory, podUID)
+			s.removeClassAggregationLocked(podUID)
+			s.broadcaster.publish(ResourceEvent{
+				PodUID:       podUID,
+				OldResources: clonePodResourceInfo(info),
+				EventType:    EventDeleted,
+			})
 		}
 	}
 }